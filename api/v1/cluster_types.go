@@ -0,0 +1,131 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package v1 contains API Schema definitions for the postgresql v1 API
+// group. This file only carries the subset of the Cluster CRD that the
+// major-version downgrade feature (pkg/reconciler/majorupgrade) depends
+// on; it is additive to the rest of the Cluster type.
+//
+// +kubebuilder:object:generate=true
+// +groupName=postgresql.cnpg.io
+package v1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterPhase represents the main phase a Cluster's reconciliation is in.
+type ClusterPhase string
+
+const (
+	// PhaseHealthy is set once a Cluster has no pending operation in progress.
+	PhaseHealthy = "Cluster in healthy state"
+
+	// PhaseMajorUpgrade is set while a major version upgrade or downgrade
+	// Job is running against the cluster's primary.
+	PhaseMajorUpgrade = "Performing a major version upgrade"
+)
+
+// PGDataImageInfo records the PostgreSQL major version of the data
+// currently on disk, as detected from PGDATA rather than from the image
+// the cluster is configured to run.
+type PGDataImageInfo struct {
+	// MajorVersion is the PostgreSQL major version PGDATA was initialized
+	// with.
+	MajorVersion int `json:"majorVersion"`
+}
+
+// ClusterSpec defines the desired state of a Cluster. Only the fields the
+// downgrade feature needs are declared here.
+type ClusterSpec struct {
+	// PostgresMajorVersion is the PostgreSQL major version the cluster is
+	// configured to run, as derived from Spec.ImageName/ImageCatalogRef by
+	// the image catalog reconciler. It is what Status.PGDataImageInfo (the
+	// version actually on disk) is compared against to detect an upgrade or
+	// downgrade.
+	PostgresMajorVersion int `json:"postgresMajorVersion"`
+
+	// PostgresVersions lists the PostgreSQL major versions this cluster is
+	// allowed to run, used to validate requested upgrades and downgrades.
+	// +optional
+	PostgresVersions []int `json:"postgresVersions,omitempty"`
+
+	// Upgrade configures behavior for in-flight major version upgrades.
+	// +optional
+	Upgrade *UpgradeConfiguration `json:"upgrade,omitempty"`
+
+	// Downgrade configures behavior for major version downgrades.
+	// +optional
+	Downgrade *DowngradeConfiguration `json:"downgrade,omitempty"`
+}
+
+// ClusterStatus defines the observed state of a Cluster. Only the fields
+// the downgrade feature needs are declared here.
+type ClusterStatus struct {
+	// Phase is the current reconciliation phase of the cluster.
+	// +optional
+	Phase ClusterPhase `json:"phase,omitempty"`
+
+	// CurrentPrimary is the name of the Pod currently acting as primary.
+	// +optional
+	CurrentPrimary string `json:"currentPrimary,omitempty"`
+
+	// PGDataImageInfo records the PostgreSQL major version of the data
+	// currently on disk. It is nil until the instance manager has reported
+	// it at least once.
+	// +optional
+	PGDataImageInfo *PGDataImageInfo `json:"pgDataImageInfo,omitempty"`
+
+	// DowngradeInfo records the status of an in-flight or most recently
+	// attempted major version downgrade.
+	// +optional
+	DowngradeInfo *DowngradeInfo `json:"downgradeInfo,omitempty"`
+}
+
+// Cluster is the Schema for the clusters API. Only the fields the
+// downgrade feature needs are declared here.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+type Cluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterSpec   `json:"spec,omitempty"`
+	Status ClusterStatus `json:"status,omitempty"`
+}
+
+// GetSuperuserSecretName returns the name of the Secret holding the
+// postgres superuser credentials, the same Secret the instance manager
+// itself uses to authenticate local connections.
+func (cluster *Cluster) GetSuperuserSecretName() string {
+	return fmt.Sprintf("%s-superuser", cluster.Name)
+}
+
+// GetPostgresqlMajorVersion returns the major version the cluster is
+// configured to run, as resolved from Spec.ImageName/ImageCatalogRef by the
+// image catalog reconciler elsewhere in the operator.
+func (cluster *Cluster) GetPostgresqlMajorVersion() (int, error) {
+	if cluster.Spec.PostgresMajorVersion <= 0 {
+		return 0, fmt.Errorf("cluster %s has no resolved PostgreSQL major version yet", cluster.Name)
+	}
+	return cluster.Spec.PostgresMajorVersion, nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DowngradePhase is a coarse-grained phase of an in-flight or completed
+// major version downgrade, surfaced on Cluster.Status.DowngradeInfo so
+// users can follow progress without reading Job logs.
+type DowngradePhase string
+
+const (
+	// DowngradePhasePlanned means the downgrade passed pre-flight validation
+	// and is queued to start.
+	DowngradePhasePlanned DowngradePhase = "Planned"
+
+	// DowngradePhaseValidating means the pre-flight validator is currently
+	// running.
+	DowngradePhaseValidating DowngradePhase = "Validating"
+
+	// DowngradePhaseDumping means the downgrade Job is dumping the old
+	// cluster.
+	DowngradePhaseDumping DowngradePhase = "Dumping"
+
+	// DowngradePhaseRestoring means the downgrade Job is restoring into the
+	// newly initialized PGDATA.
+	DowngradePhaseRestoring DowngradePhase = "Restoring"
+
+	// DowngradePhaseFailed means the downgrade was refused by validation or
+	// the downgrade Job failed.
+	DowngradePhaseFailed DowngradePhase = "Failed"
+
+	// DowngradePhaseCompleted means the downgrade Job finished successfully.
+	DowngradePhaseCompleted DowngradePhase = "Completed"
+)
+
+// DowngradeInfo records the status of an in-flight or most recently
+// attempted major version downgrade.
+type DowngradeInfo struct {
+	// Enabled is true once a downgrade has been validated and queued.
+	Enabled bool `json:"enabled"`
+
+	// TargetVersion is the PostgreSQL major version being downgraded to.
+	TargetVersion string `json:"targetVersion"`
+
+	// StartedAt is when the downgrade was first queued.
+	// +optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// Phase is the current phase of the downgrade.
+	Phase DowngradePhase `json:"phase"`
+
+	// Reason explains why Phase is Failed, so users can diagnose a refused
+	// or failed downgrade without reading the Job logs.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Progress reports dump/restore progress while the downgrade Job is
+	// running.
+	// +optional
+	Progress *DowngradeProgress `json:"progress,omitempty"`
+}
+
+// DatabaseDowngradeProgress reports dump/restore progress for a single
+// database.
+type DatabaseDowngradeProgress struct {
+	// Name is the database name.
+	Name string `json:"name"`
+
+	// BytesDone is the number of bytes dumped or restored so far, as
+	// reported by `du` against the per-database dump directory.
+	BytesDone int64 `json:"bytesDone"`
+
+	// BytesTotal is the size of the database's dump. The downgrade Job
+	// does not set it, so it is always zero.
+	// +optional
+	BytesTotal int64 `json:"bytesTotal,omitempty"`
+}
+
+// DowngradeProgress reports the current phase transition and, while
+// dumping or restoring, per-database byte counts for an in-flight
+// downgrade.
+type DowngradeProgress struct {
+	// Phase is the DowngradePhase executeDowngrade is currently in:
+	// "Dumping" or "Restoring".
+	Phase string `json:"phase"`
+
+	// Databases reports progress for the phase currently running. Each
+	// update replaces the list, so it holds only the database that most
+	// recently finished that phase, and is empty when the phase starts.
+	// +optional
+	Databases []DatabaseDowngradeProgress `json:"databases,omitempty"`
+}
+
+// ScriptSource references a single key of a ConfigMap or a Secret holding a
+// shell script, mirroring corev1.EnvVarSource's ConfigMapKeyRef/SecretKeyRef
+// pair. Exactly one of the two should be set.
+type ScriptSource struct {
+	// ConfigMapKeyRef selects the script from a ConfigMap key.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects the script from a Secret key.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// UpgradeConfiguration configures behavior for in-flight major version
+// upgrades.
+type UpgradeConfiguration struct {
+	// Cancel is the symmetric counterpart of Downgrade.Cancel, reserved for
+	// aborting an in-flight major version upgrade.
+	//
+	// Scope note: this series (pkg/reconciler/majorupgrade) only implements
+	// downgrades; there is no upgrade reconciler in this codebase for this
+	// field to be read by yet, so setting it today has no effect. It is
+	// declared now so the Cluster CRD doesn't need an incompatible change
+	// once upgrade-cancel support is added.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// DowngradeConfiguration configures behavior for major version downgrades.
+type DowngradeConfiguration struct {
+	// Cancel aborts an in-flight downgrade when set while
+	// Cluster.Status.Phase is PhaseMajorUpgrade: the running downgrade Job
+	// is deleted and PGDATA.old is restored.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+
+	// AutoRollback, when true, makes the operator automatically roll back
+	// a downgrade Job that reached the Failed condition, instead of
+	// waiting for an operator to run `instance downgrade rollback`
+	// manually.
+	// +optional
+	AutoRollback bool `json:"autoRollback,omitempty"`
+
+	// ParallelJobs is the number of parallel pg_dump/pg_restore jobs to
+	// use. Defaults to min(4, vCPUs) when unset.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ParallelJobs int `json:"parallelJobs,omitempty"`
+
+	// ExtraEnv adds environment variables to the downgrade Job's container,
+	// e.g. PGOPTIONS, proxy variables, or credentials for an external
+	// object store.
+	// +optional
+	ExtraEnv []corev1.EnvVar `json:"extraEnv,omitempty"`
+
+	// ExtraEnvFrom adds environment variables sourced from a ConfigMap or
+	// Secret to the downgrade Job's container.
+	// +optional
+	ExtraEnvFrom []corev1.EnvFromSource `json:"extraEnvFrom,omitempty"`
+
+	// PreDumpScript, when set, is run with `bash -e` after the old instance
+	// is started and before it is dumped.
+	// +optional
+	PreDumpScript *ScriptSource `json:"preDumpScript,omitempty"`
+
+	// PostRestoreScript, when set, is run with `bash -e` after the restore
+	// into the new instance completes, while it is still running.
+	// +optional
+	PostRestoreScript *ScriptSource `json:"postRestoreScript,omitempty"`
+
+	// AvailableExtensions lists the extensions known to be packaged in the
+	// target image. Pre-flight validation refuses the downgrade when an
+	// extension installed in the primary's postgres database isn't in this
+	// list (other databases are not inspected), so a
+	// downgrade doesn't fail partway through the restore for lack of an
+	// extension's control file. There is no way to derive this
+	// automatically: validation only has a connection to the primary,
+	// which is still running the current (newer) image and whose own
+	// catalog says nothing about what the target image provides. Leave it
+	// unset to skip this check.
+	// +optional
+	AvailableExtensions []string `json:"availableExtensions,omitempty"`
+}
@@ -0,0 +1,657 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package downgrade
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cloudnative-pg/machinery/pkg/execlog"
+	"github.com/cloudnative-pg/machinery/pkg/fileutils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/management/postgres"
+)
+
+// preDumpScriptEnvVar and postRestoreScriptEnvVar name the environment
+// variables the downgrade Job sets, when Cluster.Spec.Downgrade.PreDumpScript
+// or PostRestoreScript are configured, to the path the hook script was
+// mounted at. They must match pkg/reconciler/majorupgrade.
+const (
+	preDumpScriptEnvVar     = "PRE_DUMP_SCRIPT"
+	postRestoreScriptEnvVar = "POST_RESTORE_SCRIPT"
+)
+
+// runHookScript runs, with `bash -e`, the script whose path is in the
+// envVar environment variable, streaming its stdout/stderr through
+// execlog.RunStreaming tagged with name. It is a no-op when envVar isn't
+// set, i.e. when the corresponding hook wasn't configured on the Cluster.
+func runHookScript(envVar, name string) error {
+	scriptPath := os.Getenv(envVar)
+	if scriptPath == "" {
+		return nil
+	}
+
+	hookCmd := exec.Command("bash", "-e", scriptPath)
+	if err := execlog.RunStreaming(hookCmd, name); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// globalsDumpFileName is the name, inside the downgrade dump directory, of
+// the plain-SQL dump of roles, tablespaces and databases produced by
+// pg_dumpall --globals-only.
+const globalsDumpFileName = "globals.sql"
+
+// sedVersionStrip is the expression used to remove the version-specific SQL
+// that pg_dumpall emits but that the target (older) major doesn't
+// understand. It only ever runs against the plain-SQL globals dump: the
+// per-database directory-format dumps are restored from their table of
+// contents, which holds no DDL text to sed over, and are instead filtered
+// entry-by-entry by filterVersionSpecificTOCEntries.
+const sedVersionStrip = `s/LOCALE_PROVIDER = \w+ |^SET transaction_timeout = 0;| WITH INHERIT TRUE GRANTED BY \w+//`
+
+// builtinCollationsFileName is the name, inside each database's dump
+// directory, of the newline-separated list of "schema.collation" names
+// using the PostgreSQL 17 builtin locale provider. It is recorded by
+// dumpCluster while the source instance is still running, since that's
+// the only place collprovider can be queried; stripVersionSpecificTOC
+// reads it back after the instance has stopped to know which TOC entries
+// are actually unsafe to restore onto the target major.
+const builtinCollationsFileName = "builtin_collations.txt"
+
+// downgradeProgressReporter streams phase transitions and per-database
+// dump/restore progress into Cluster.Status.DowngradeInfo.Progress, so users
+// can follow a long-running downgrade without reading Job logs. Reporting is
+// best-effort: a failure to reach the API server never fails the downgrade
+// itself, it is only logged.
+type downgradeProgressReporter struct {
+	client      client.Client
+	clusterName string
+	namespace   string
+}
+
+// newDowngradeProgressReporter builds a reporter for instance, or, after
+// logging why, a reporter that no-ops when a client to the API server can't
+// be built (e.g. outside a real cluster), so executeDowngrade can always call
+// it unconditionally.
+func newDowngradeProgressReporter(instance *postgres.Instance) *downgradeProgressReporter {
+	reporter := &downgradeProgressReporter{
+		clusterName: instance.GetClusterName(),
+		namespace:   instance.GetNamespaceName(),
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Printf("downgrade progress reporting disabled: %v", err)
+		return reporter
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		log.Printf("downgrade progress reporting disabled: %v", err)
+		return reporter
+	}
+	reporter.client = c
+	return reporter
+}
+
+// report updates Cluster.Status.DowngradeInfo.Progress to phase and
+// databases.
+func (r *downgradeProgressReporter) report(ctx context.Context, phase apiv1.DowngradePhase, databases []apiv1.DatabaseDowngradeProgress) {
+	if r == nil || r.client == nil {
+		return
+	}
+
+	var cluster apiv1.Cluster
+	key := client.ObjectKey{Namespace: r.namespace, Name: r.clusterName}
+	if err := r.client.Get(ctx, key, &cluster); err != nil {
+		log.Printf("while reporting downgrade progress: %v", err)
+		return
+	}
+
+	if cluster.Status.DowngradeInfo == nil {
+		cluster.Status.DowngradeInfo = &apiv1.DowngradeInfo{}
+	}
+	cluster.Status.DowngradeInfo.Progress = &apiv1.DowngradeProgress{
+		Phase:     string(phase),
+		Databases: databases,
+	}
+
+	if err := r.client.Status().Update(ctx, &cluster); err != nil {
+		log.Printf("while reporting downgrade progress: %v", err)
+	}
+}
+
+// reportDatabaseDone reports that db finished the given phase, recording its
+// dump/restore size as reported by `du`.
+func (r *downgradeProgressReporter) reportDatabaseDone(ctx context.Context, phase apiv1.DowngradePhase, dbDumpDir, db string) {
+	bytesDone, err := diskUsage(dbDumpDir)
+	if err != nil {
+		log.Printf("while measuring progress of database %q: %v", db, err)
+	}
+	r.report(ctx, phase, []apiv1.DatabaseDowngradeProgress{{Name: db, BytesDone: int64(bytesDone)}})
+}
+
+// executeDowngrade performs (or resumes) a major version downgrade. It is
+// idempotent: on every invocation it reads the on-disk downgrade state and
+// picks up after the last completed phase, so a crash or Job restart never
+// repeats dump/restore work that already finished, nor touches data it has
+// already moved out of the way.
+func executeDowngrade(ctx context.Context, instance *postgres.Instance, pgData string, parallelJobs int) error {
+	if pgData == "" {
+		return fmt.Errorf("PGDATA not set")
+	}
+
+	state, err := loadDowngradeState(pgData)
+	if err != nil {
+		return fmt.Errorf("while loading downgrade state: %w", err)
+	}
+	if state.Phase == phaseFinalized {
+		return nil
+	}
+
+	if err := checkDowngradeInvariants(pgData, state); err != nil {
+		return fmt.Errorf("pre-flight check failed: %w", err)
+	}
+
+	if err := fileutils.EnsureDirectoryExists(postgres.GetSocketDir()); err != nil {
+		return fmt.Errorf("while creating socket directory: %w", err)
+	}
+
+	dumpDir := path.Join(filepath.Dir(pgData), "downgrade_dump")
+	if err := fileutils.EnsureDirectoryExists(dumpDir); err != nil {
+		return fmt.Errorf("while creating dump directory: %w", err)
+	}
+
+	if !state.reached(phasePreFlightDone) {
+		if err := saveDowngradeState(pgData, phasePreFlightDone); err != nil {
+			return err
+		}
+		state.Phase = phasePreFlightDone
+	}
+
+	reporter := newDowngradeProgressReporter(instance)
+
+	if !state.reached(phaseDumpComplete) {
+		reporter.report(ctx, apiv1.DowngradePhaseDumping, nil)
+		if err := dumpOldCluster(ctx, reporter, pgData, dumpDir, parallelJobs); err != nil {
+			return err
+		}
+		if err := saveDowngradeState(pgData, phaseDumpComplete); err != nil {
+			return err
+		}
+		state.Phase = phaseDumpComplete
+	}
+
+	if !state.reached(phaseOldRenamed) {
+		if err := os.Rename(pgData, pgData+".old"); err != nil {
+			return fmt.Errorf("failed to rename PGDATA: %w", err)
+		}
+		if err := fsyncDir(filepath.Dir(pgData)); err != nil {
+			return err
+		}
+		if err := saveDowngradeState(pgData, phaseOldRenamed); err != nil {
+			return err
+		}
+		state.Phase = phaseOldRenamed
+	}
+
+	if !state.reached(phaseInitdbDone) {
+		initCmd := exec.Command("initdb", "-D", pgData, "--username", "postgres")
+		if err := execlog.RunStreaming(initCmd, "initdb"); err != nil {
+			return fmt.Errorf("initdb failed: %w", err)
+		}
+		if err := saveDowngradeState(pgData, phaseInitdbDone); err != nil {
+			return err
+		}
+		state.Phase = phaseInitdbDone
+	}
+
+	if !state.reached(phaseRestoreDone) {
+		reporter.report(ctx, apiv1.DowngradePhaseRestoring, nil)
+		if err := restoreNewCluster(ctx, reporter, pgData, dumpDir, parallelJobs); err != nil {
+			return err
+		}
+		if err := saveDowngradeState(pgData, phaseRestoreDone); err != nil {
+			return err
+		}
+		state.Phase = phaseRestoreDone
+	}
+
+	// Clean up
+	if err := os.RemoveAll(pgData + ".old"); err != nil {
+		return fmt.Errorf("failed to remove old PGDATA: %w", err)
+	}
+	if err := os.RemoveAll(dumpDir); err != nil {
+		return fmt.Errorf("failed to remove dump directory: %w", err)
+	}
+	if err := fsyncDir(filepath.Dir(pgData)); err != nil {
+		return err
+	}
+
+	return saveDowngradeState(pgData, phaseFinalized)
+}
+
+// dumpOldCluster runs the old instance, dumps it, and removes the
+// configuration that won't survive the downgrade. A resumed attempt that
+// stopped before phaseDumpComplete was recorded runs it again from the start;
+// callers must not invoke it once phaseDumpComplete has been reached.
+func dumpOldCluster(ctx context.Context, reporter *downgradeProgressReporter, pgData, dumpDir string, parallelJobs int) error {
+	// Remove incompatible config files
+	if err := os.Remove(path.Join(pgData, "custom.conf")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove custom.conf: %w", err)
+	}
+	sedCmd := exec.Command("sed", "-i", "/include.*custom.conf/d", path.Join(pgData, "postgresql.conf"))
+	if err := execlog.RunStreaming(sedCmd, "sed"); err != nil {
+		return fmt.Errorf("sed failed: %w", err)
+	}
+
+	// Start the existing PostgreSQL instance to dump data
+	startCmd := exec.Command("pg_ctl", "-D", pgData, "-w", "start")
+	if err := execlog.RunStreaming(startCmd, "pg_ctl"); err != nil {
+		return fmt.Errorf("pg_ctl start failed: %w", err)
+	}
+
+	if err := runHookScript(preDumpScriptEnvVar, "pre-dump"); err != nil {
+		exec.Command("pg_ctl", "-D", pgData, "stop").Run() //nolint:errcheck
+		return err
+	}
+
+	if err := dumpCluster(ctx, reporter, pgData, dumpDir, parallelJobs); err != nil {
+		exec.Command("pg_ctl", "-D", pgData, "stop").Run() //nolint:errcheck
+		return err
+	}
+
+	// Stop the old instance
+	stopCmd := exec.Command("pg_ctl", "-D", pgData, "-w", "stop")
+	if err := execlog.RunStreaming(stopCmd, "pg_ctl"); err != nil {
+		return fmt.Errorf("pg_ctl stop failed: %w", err)
+	}
+
+	return stripVersionSpecificSQL(dumpDir)
+}
+
+// restoreNewCluster starts the freshly initdb'd instance and replays the
+// dump produced by dumpOldCluster into it.
+func restoreNewCluster(ctx context.Context, reporter *downgradeProgressReporter, pgData, dumpDir string, parallelJobs int) error {
+	startCmd := exec.Command("pg_ctl", "-D", pgData, "-w", "start")
+	if err := execlog.RunStreaming(startCmd, "pg_ctl"); err != nil {
+		return fmt.Errorf("pg_ctl start failed: %w", err)
+	}
+
+	if err := restoreCluster(ctx, reporter, pgData, dumpDir, parallelJobs); err != nil {
+		exec.Command("pg_ctl", "-D", pgData, "stop").Run() //nolint:errcheck
+		return err
+	}
+
+	if err := runHookScript(postRestoreScriptEnvVar, "post-restore"); err != nil {
+		exec.Command("pg_ctl", "-D", pgData, "stop").Run() //nolint:errcheck
+		return err
+	}
+
+	stopCmd := exec.Command("pg_ctl", "-D", pgData, "-w", "stop")
+	if err := execlog.RunStreaming(stopCmd, "pg_ctl"); err != nil {
+		return fmt.Errorf("pg_ctl stop failed: %w", err)
+	}
+
+	return nil
+}
+
+// dumpCluster dumps the globals and every user database of the running
+// instance into dumpDir, using a directory-format, parallel pg_dump per
+// database so that large clusters can be dumped in a reasonable time. Each
+// database's dump is idempotent: a resumed run that finds a previous,
+// possibly partial dump re-dumps that database from scratch rather than
+// failing against it.
+func dumpCluster(ctx context.Context, reporter *downgradeProgressReporter, pgData, dumpDir string, parallelJobs int) error {
+	globalsCmd := exec.Command("pg_dumpall", "--globals-only", "-f", path.Join(dumpDir, globalsDumpFileName))
+	if err := execlog.RunStreaming(globalsCmd, "pg_dumpall"); err != nil {
+		return fmt.Errorf("pg_dumpall --globals-only failed: %w", err)
+	}
+
+	databases, err := listUserDatabases(ctx)
+	if err != nil {
+		return fmt.Errorf("while listing databases to dump: %w", err)
+	}
+
+	for _, db := range databases {
+		dbDumpDir := path.Join(dumpDir, db)
+
+		// A resumed run may find dbDumpDir already here from a dump that was
+		// interrupted mid-write: pg_dump's directory format refuses to write
+		// into a directory that already exists, which would otherwise wedge
+		// every retry on the same error. Wipe it first so each database is
+		// dumped from scratch, whether this is its first attempt or a retry.
+		if err := os.RemoveAll(dbDumpDir); err != nil {
+			return fmt.Errorf("while clearing a stale dump directory for database %q: %w", db, err)
+		}
+
+		dumpCmd := exec.Command("pg_dump", "-Fd", "-j", strconv.Itoa(parallelJobs), "-f", dbDumpDir, db)
+		if err := execlog.RunStreaming(dumpCmd, "pg_dump"); err != nil {
+			return fmt.Errorf("pg_dump of database %q failed: %w", db, err)
+		}
+
+		// collprovider can only be queried while the source instance is
+		// still running: record it now so stripVersionSpecificTOC, which
+		// runs after the instance has stopped, knows exactly which
+		// COLLATION entries are unsafe to restore onto the target major
+		// instead of having to drop every collation unconditionally.
+		builtinCollations, err := queryBuiltinProviderCollations(ctx, db)
+		if err != nil {
+			return fmt.Errorf("while checking collation providers of database %q: %w", db, err)
+		}
+		builtinCollationsPath := path.Join(dbDumpDir, builtinCollationsFileName)
+		if err := os.WriteFile(builtinCollationsPath, []byte(strings.Join(builtinCollations, "\n")), 0o600); err != nil {
+			return fmt.Errorf("while recording builtin-provider collations of database %q: %w", db, err)
+		}
+
+		reporter.reportDatabaseDone(ctx, apiv1.DowngradePhaseDumping, dbDumpDir, db)
+	}
+
+	return nil
+}
+
+// queryBuiltinProviderCollations returns the schema-qualified names of the
+// collations in db using the PostgreSQL 17 "builtin" locale provider
+// (pg_collation.collprovider = 'b'), the only locale provider whose
+// CREATE COLLATION syntax a pre-17 pg_restore doesn't understand: ICU and
+// libc collations have been restorable across majors since ICU support
+// was added in PG10.
+func queryBuiltinProviderCollations(_ context.Context, db string) ([]string, error) {
+	listCmd := exec.Command("psql", "-Atqc",
+		`SELECT quote_ident(n.nspname) || '.' || quote_ident(c.collname)
+		 FROM pg_collation c JOIN pg_namespace n ON n.oid = c.collnamespace
+		 WHERE c.collprovider = 'b'`, db)
+	out, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("psql failed: %w", err)
+	}
+
+	return splitNonEmptyLines(string(out)), nil
+}
+
+// restoreCluster replays the globals dump and then restores every user
+// database dumped by dumpCluster, using a parallel pg_restore per database.
+// Each database's restore is idempotent: a resumed run that finds the
+// database already created by a previous, possibly partial restore drops it
+// and restores from scratch rather than failing against it.
+func restoreCluster(ctx context.Context, reporter *downgradeProgressReporter, pgData, dumpDir string, parallelJobs int) error {
+	globalsCmd := exec.Command("psql", "-f", path.Join(dumpDir, globalsDumpFileName), "postgres")
+	if err := execlog.RunStreaming(globalsCmd, "psql"); err != nil {
+		return fmt.Errorf("replaying globals failed: %w", err)
+	}
+
+	databases, err := listDumpedDatabases(dumpDir)
+	if err != nil {
+		return fmt.Errorf("while listing dumped databases: %w", err)
+	}
+
+	for _, db := range databases {
+		// A resumed run may find db already created from a restore that was
+		// interrupted mid-pg_restore: createdb would otherwise hard-fail on
+		// every retry with "database already exists". Drop it first so each
+		// database is restored from scratch, whether this is its first
+		// attempt or a retry.
+		dropCmd := exec.Command("dropdb", "--if-exists", db)
+		if err := execlog.RunStreaming(dropCmd, "dropdb"); err != nil {
+			return fmt.Errorf("dropping a stale restore of database %q failed: %w", db, err)
+		}
+
+		createCmd := exec.Command("createdb", db)
+		if err := execlog.RunStreaming(createCmd, "createdb"); err != nil {
+			return fmt.Errorf("creating database %q failed: %w", db, err)
+		}
+
+		dbDumpDir := path.Join(dumpDir, db)
+		restoreCmd := exec.Command("pg_restore",
+			"-j", strconv.Itoa(parallelJobs),
+			"-d", db,
+			"-L", path.Join(dbDumpDir, "toc.list"),
+			"--exit-on-error",
+			dbDumpDir)
+		if err := execlog.RunStreaming(restoreCmd, "pg_restore"); err != nil {
+			return fmt.Errorf("pg_restore of database %q failed: %w", db, err)
+		}
+		reporter.reportDatabaseDone(ctx, apiv1.DowngradePhaseRestoring, dbDumpDir, db)
+	}
+
+	return nil
+}
+
+// stripVersionSpecificSQL removes, from the globals dump, the SQL that
+// pg_dumpall emits but that the target (older) major doesn't understand,
+// and drops the table-of-contents entries of every per-database dump that
+// the target major's pg_restore can't be relied on to restore.
+func stripVersionSpecificSQL(dumpDir string) error {
+	sedCmd := exec.Command("sed", "-i", "-E", sedVersionStrip, path.Join(dumpDir, globalsDumpFileName))
+	if err := execlog.RunStreaming(sedCmd, "sed"); err != nil {
+		return fmt.Errorf("sed on globals dump failed: %w", err)
+	}
+
+	databases, err := listDumpedDatabases(dumpDir)
+	if err != nil {
+		return fmt.Errorf("while listing dumped databases: %w", err)
+	}
+
+	for _, db := range databases {
+		if err := stripVersionSpecificTOC(path.Join(dumpDir, db), db); err != nil {
+			return fmt.Errorf("stripping table of contents of database %q: %w", db, err)
+		}
+	}
+
+	return nil
+}
+
+// stripVersionSpecificTOC lists the table of contents of a directory-format
+// dump with `pg_restore -l`, comments out the entries
+// filterVersionSpecificTOCEntries deems unsafe to restore onto the target
+// major, and writes the result to toc.list for restoreCluster to pass to
+// `pg_restore -L`. Any entry dropped this way is logged against db, since
+// it means an object from that database won't come back after the
+// downgrade.
+func stripVersionSpecificTOC(dbDumpDir, db string) error {
+	listCmd := exec.Command("pg_restore", "-l", dbDumpDir)
+	rawTOC, err := listCmd.Output()
+	if err != nil {
+		return fmt.Errorf("pg_restore -l failed: %w", err)
+	}
+
+	builtinCollationsContent, err := os.ReadFile(path.Join(dbDumpDir, builtinCollationsFileName))
+	if err != nil {
+		return fmt.Errorf("reading recorded builtin-provider collations: %w", err)
+	}
+	builtinCollations := splitNonEmptyLines(string(builtinCollationsContent))
+
+	filteredTOC, dropped := filterVersionSpecificTOCEntries(rawTOC, builtinCollations)
+	if len(dropped) > 0 {
+		log.Printf("database %q: dropping %d TOC entries using the builtin collation provider, "+
+			"unsupported by the downgrade target: %v", db, len(dropped), dropped)
+	}
+
+	tocPath := path.Join(dbDumpDir, "toc.list")
+	if err := os.WriteFile(tocPath, filteredTOC, 0o600); err != nil {
+		return fmt.Errorf("writing table of contents: %w", err)
+	}
+
+	return nil
+}
+
+// filterVersionSpecificTOCEntries comments out, by prefixing its line with
+// ";" as `pg_restore -l`/`-L` expect, every COLLATION table-of-contents
+// entry whose schema-qualified name ("schema.tag") is in
+// builtinCollations, and returns those names. A pg_restore -l line for an
+// actual entry has the form
+// "<dumpId>; <catalogId> <objId> <DESC> <namespace> <tag> <owner>"; lines
+// pg_restore already emits as comments (the header, blank lines) are left
+// untouched. Other collations (the default libc/ICU providers) restore
+// fine on the target major and are left alone.
+func filterVersionSpecificTOCEntries(rawTOC []byte, builtinCollations []string) ([]byte, []string) {
+	excluded := make(map[string]bool, len(builtinCollations))
+	for _, name := range builtinCollations {
+		excluded[name] = true
+	}
+
+	var dropped []string
+	lines := strings.Split(string(rawTOC), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), ";") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		const (
+			descFieldIndex      = 3
+			namespaceFieldIndex = 4
+			tagFieldIndex       = 5
+		)
+		if len(fields) <= tagFieldIndex || fields[descFieldIndex] != "COLLATION" {
+			continue
+		}
+
+		name := fields[namespaceFieldIndex] + "." + fields[tagFieldIndex]
+		if excluded[name] {
+			lines[i] = "; " + line
+			dropped = append(dropped, name)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), dropped
+}
+
+// listUserDatabases returns the names of the databases that should be
+// dumped, excluding templates and the postgres maintenance database.
+func listUserDatabases(_ context.Context) ([]string, error) {
+	listCmd := exec.Command("psql", "-Atqc",
+		"SELECT datname FROM pg_database WHERE NOT datistemplate AND datname <> 'postgres'", "postgres")
+	out, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("psql failed: %w", err)
+	}
+
+	return splitNonEmptyLines(string(out)), nil
+}
+
+// listDumpedDatabases returns the names of the databases that were dumped
+// by dumpCluster, derived from the per-database subdirectories of dumpDir.
+func listDumpedDatabases(dumpDir string) ([]string, error) {
+	entries, err := os.ReadDir(dumpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var databases []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			databases = append(databases, entry.Name())
+		}
+	}
+	return databases, nil
+}
+
+// checkDowngradeInvariants verifies the invariants executeDowngrade assumes
+// before it starts touching data: the target PostgreSQL version's tooling
+// must be on PATH, no leftover PGDATA.old from an untracked previous attempt
+// may be present, and the PVC must have enough free space to hold the dump,
+// the new PGDATA and the old PGDATA at the same time. These checks only
+// apply to a fresh attempt: once state has progressed, PGDATA.old existing
+// (or free space being tighter, now that the dump already exists) is
+// expected, not an error.
+func checkDowngradeInvariants(pgData string, state downgradeState) error {
+	if _, err := exec.LookPath("initdb"); err != nil {
+		return fmt.Errorf("target PostgreSQL version is not available in this image: %w", err)
+	}
+
+	if state.Phase != "" {
+		return nil
+	}
+
+	if _, err := os.Stat(pgData + ".old"); err == nil {
+		return fmt.Errorf("%s already exists, a previous downgrade attempt may not have completed", pgData+".old")
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("while checking for a leftover %s: %w", pgData+".old", err)
+	}
+
+	return checkFreeSpace(pgData)
+}
+
+// checkFreeSpace rejects the downgrade unless the PVC backing PGDATA has at
+// least twice the space PGDATA currently occupies, since the dump, the new
+// PGDATA and the old PGDATA must all coexist on disk during the restore.
+func checkFreeSpace(pgData string) error {
+	used, err := diskUsage(pgData)
+	if err != nil {
+		return fmt.Errorf("while computing PGDATA size: %w", err)
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(pgData, &stat); err != nil {
+		return fmt.Errorf("while statting PGDATA filesystem: %w", err)
+	}
+	available := stat.Bavail * uint64(stat.Bsize) //nolint:unconvert
+
+	if required := 2 * used; available < required {
+		return fmt.Errorf("not enough free space for the downgrade: need at least %d bytes, have %d", required, available)
+	}
+
+	return nil
+}
+
+// diskUsage returns the size, in bytes, occupied by pgData, as reported by
+// `du -sb`.
+func diskUsage(pgData string) (uint64, error) {
+	duCmd := exec.Command("du", "-sb", pgData)
+	out, err := duCmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("du failed: %w", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected du output: %q", out)
+	}
+
+	size, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("while parsing du output %q: %w", out, err)
+	}
+	return size, nil
+}
+
+func splitNonEmptyLines(s string) []string {
+	var result []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package downgrade
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checkFreeSpace", func() {
+	It("accepts a directory with ample free space relative to its own size", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "data"), []byte("hello"), 0o600)).To(Succeed())
+
+		Expect(checkFreeSpace(dir)).To(Succeed())
+	})
+})
+
+var _ = Describe("filterVersionSpecificTOCEntries", func() {
+	rawTOC := strings.Join([]string{
+		";",
+		"; Archive created at 2024-01-01 00:00:00 UTC",
+		";     dbname: mydb",
+		";",
+		"185; 1259 16396 TABLE public foo postgres",
+		"3226; 0 0 COLLATION public mycoll postgres",
+		"3227; 0 0 COLLATION public othercoll postgres",
+		"6; 2615 2200 SCHEMA - public postgres",
+	}, "\n")
+
+	It("only comments out COLLATION entries in the builtin-provider list", func() {
+		filtered, dropped := filterVersionSpecificTOCEntries([]byte(rawTOC), []string{"public.mycoll"})
+
+		Expect(string(filtered)).To(ContainSubstring("185; 1259 16396 TABLE public foo postgres"))
+		Expect(string(filtered)).To(ContainSubstring("; 3226; 0 0 COLLATION public mycoll postgres"))
+		Expect(string(filtered)).To(ContainSubstring("3227; 0 0 COLLATION public othercoll postgres"))
+		Expect(string(filtered)).To(ContainSubstring("6; 2615 2200 SCHEMA - public postgres"))
+		Expect(string(filtered)).To(ContainSubstring("; Archive created at 2024-01-01 00:00:00 UTC"))
+		Expect(dropped).To(Equal([]string{"public.mycoll"}))
+	})
+
+	It("leaves every COLLATION entry alone when nothing uses the builtin provider", func() {
+		filtered, dropped := filterVersionSpecificTOCEntries([]byte(rawTOC), nil)
+
+		Expect(string(filtered)).To(Equal(rawTOC))
+		Expect(dropped).To(BeEmpty())
+	})
+})
+
+var _ = Describe("splitNonEmptyLines", func() {
+	It("drops blank and whitespace-only lines", func() {
+		Expect(splitNonEmptyLines("a\n\nb \n  \nc\n")).To(Equal([]string{"a", "b", "c"}))
+	})
+
+	It("returns nil for empty input", func() {
+		Expect(splitNonEmptyLines("")).To(BeNil())
+	})
+})
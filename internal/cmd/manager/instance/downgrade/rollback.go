@@ -0,0 +1,76 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package downgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// executeRollback undoes a downgrade attempt that failed before reaching
+// phaseFinalized: it moves PGDATA.old back into place when the rename had
+// happened and removes the dump directory. The configuration edits
+// dumpOldCluster makes to PGDATA (removing custom.conf and its include line
+// from postgresql.conf) are not undone. It is triggered automatically by ReconcileDowngrade
+// when it observes a failed downgrade Job and
+// Cluster.Spec.Downgrade.AutoRollback is set, or manually via
+// `instance downgrade rollback`.
+func executeRollback(_ context.Context, pgData string) error {
+	state, err := loadDowngradeState(pgData)
+	if err != nil {
+		return fmt.Errorf("while loading downgrade state: %w", err)
+	}
+
+	if state.Phase == "" {
+		// Nothing to roll back: either no downgrade was ever started, or a
+		// previous rollback already cleared the state. Treat this as success
+		// rather than an error, so a rollback Job racing ahead of (or
+		// retried after) the downgrade's own cleanup doesn't get stuck.
+		return nil
+	}
+	if state.Phase == phaseFinalized {
+		return fmt.Errorf("downgrade of %s already finalized, refusing to roll back", pgData)
+	}
+
+	if state.reached(phaseOldRenamed) {
+		if _, err := os.Stat(pgData + ".old"); err != nil {
+			return fmt.Errorf("%s not found, cannot roll back: %w", pgData+".old", err)
+		}
+
+		if err := os.RemoveAll(pgData); err != nil {
+			return fmt.Errorf("while removing the half-built new PGDATA: %w", err)
+		}
+		if err := os.Rename(pgData+".old", pgData); err != nil {
+			return fmt.Errorf("while restoring PGDATA from %s: %w", pgData+".old", err)
+		}
+		if err := fsyncDir(filepath.Dir(pgData)); err != nil {
+			return err
+		}
+	}
+
+	dumpDir := filepath.Join(filepath.Dir(pgData), "downgrade_dump")
+	if err := os.RemoveAll(dumpDir); err != nil {
+		return fmt.Errorf("while removing the downgrade dump directory: %w", err)
+	}
+
+	return clearDowngradeState(pgData)
+}
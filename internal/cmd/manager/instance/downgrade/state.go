@@ -0,0 +1,156 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package downgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// downgradePhase is a phase of executeDowngrade whose completion is
+// persisted to disk, so a crash can be resumed from the last completed
+// phase instead of restarting from scratch.
+type downgradePhase string
+
+const (
+	phasePreFlightDone downgradePhase = "PreFlightDone"
+	phaseDumpComplete  downgradePhase = "DumpComplete"
+	phaseOldRenamed    downgradePhase = "OldRenamed"
+	phaseInitdbDone    downgradePhase = "InitdbDone"
+	phaseRestoreDone   downgradePhase = "RestoreDone"
+	phaseFinalized     downgradePhase = "Finalized"
+)
+
+// downgradeStateFileName is the name, next to PGDATA, of the file tracking
+// downgrade progress across restarts.
+const downgradeStateFileName = "downgrade.state.json"
+
+// downgradeState is the on-disk record of how far executeDowngrade got. It
+// is written atomically after every phase transition.
+type downgradeState struct {
+	Phase downgradePhase `json:"phase"`
+}
+
+// downgradeStatePath returns the path of the state file for the given
+// PGDATA, stored next to it so it survives a PGDATA <-> PGDATA.old rename.
+func downgradeStatePath(pgData string) string {
+	return filepath.Join(filepath.Dir(pgData), downgradeStateFileName)
+}
+
+// loadDowngradeState reads the state file, returning a zero-value state
+// (no phase reached) when the file does not exist yet.
+func loadDowngradeState(pgData string) (downgradeState, error) {
+	content, err := os.ReadFile(downgradeStatePath(pgData))
+	if os.IsNotExist(err) {
+		return downgradeState{}, nil
+	}
+	if err != nil {
+		return downgradeState{}, fmt.Errorf("while reading downgrade state: %w", err)
+	}
+
+	var state downgradeState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return downgradeState{}, fmt.Errorf("while parsing downgrade state: %w", err)
+	}
+	return state, nil
+}
+
+// saveDowngradeState records that phase has been completed. It writes the
+// file atomically (temp file + fsync + rename + fsync of the parent
+// directory) so a crash can never observe a half-written state file.
+func saveDowngradeState(pgData string, phase downgradePhase) error {
+	statePath := downgradeStatePath(pgData)
+	content, err := json.Marshal(downgradeState{Phase: phase})
+	if err != nil {
+		return fmt.Errorf("while encoding downgrade state: %w", err)
+	}
+
+	tmpPath := statePath + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("while creating temporary downgrade state file: %w", err)
+	}
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return fmt.Errorf("while writing temporary downgrade state file: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return fmt.Errorf("while fsyncing temporary downgrade state file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("while closing temporary downgrade state file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, statePath); err != nil {
+		return fmt.Errorf("while renaming downgrade state file: %w", err)
+	}
+
+	return fsyncDir(filepath.Dir(statePath))
+}
+
+// clearDowngradeState removes the state file, marking a rolled-back
+// downgrade as fully dealt with. A finalized downgrade is not cleared: its
+// state file keeps recording phaseFinalized.
+func clearDowngradeState(pgData string) error {
+	statePath := downgradeStatePath(pgData)
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while removing downgrade state file: %w", err)
+	}
+	return fsyncDir(filepath.Dir(statePath))
+}
+
+// reached reports whether the state has progressed at least as far as
+// phase, using the fixed phase ordering executeDowngrade follows.
+func (s downgradeState) reached(phase downgradePhase) bool {
+	order := []downgradePhase{
+		phasePreFlightDone,
+		phaseDumpComplete,
+		phaseOldRenamed,
+		phaseInitdbDone,
+		phaseRestoreDone,
+		phaseFinalized,
+	}
+
+	currentIdx, targetIdx := -1, -1
+	for i, p := range order {
+		if p == s.Phase {
+			currentIdx = i
+		}
+		if p == phase {
+			targetIdx = i
+		}
+	}
+	return currentIdx >= targetIdx
+}
+
+// fsyncDir fsyncs a directory so that a preceding rename or file creation
+// within it is durable across a crash.
+func fsyncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("while opening %s for fsync: %w", dir, err)
+	}
+	defer dirFile.Close() //nolint:errcheck
+
+	return dirFile.Sync()
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package downgrade
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("downgradeState.reached", func() {
+	It("reports no phase reached on a fresh state", func() {
+		state := downgradeState{}
+		Expect(state.reached(phasePreFlightDone)).To(BeFalse())
+		Expect(state.reached(phaseFinalized)).To(BeFalse())
+	})
+
+	It("reports earlier phases as reached once a later phase is recorded", func() {
+		state := downgradeState{Phase: phaseRestoreDone}
+		Expect(state.reached(phasePreFlightDone)).To(BeTrue())
+		Expect(state.reached(phaseDumpComplete)).To(BeTrue())
+		Expect(state.reached(phaseOldRenamed)).To(BeTrue())
+		Expect(state.reached(phaseInitdbDone)).To(BeTrue())
+		Expect(state.reached(phaseRestoreDone)).To(BeTrue())
+	})
+
+	It("reports later phases as not reached", func() {
+		state := downgradeState{Phase: phaseDumpComplete}
+		Expect(state.reached(phaseOldRenamed)).To(BeFalse())
+		Expect(state.reached(phaseFinalized)).To(BeFalse())
+	})
+
+	It("reports a phase as reached against itself", func() {
+		state := downgradeState{Phase: phaseOldRenamed}
+		Expect(state.reached(phaseOldRenamed)).To(BeTrue())
+	})
+})
+
+var _ = Describe("downgrade state persistence", func() {
+	It("round-trips through save and load", func() {
+		pgData := filepath.Join(GinkgoT().TempDir(), "pgdata")
+		Expect(loadDowngradeStateOrFail(pgData)).To(Equal(downgradeState{}))
+
+		Expect(saveDowngradeState(pgData, phaseDumpComplete)).To(Succeed())
+		state := loadDowngradeStateOrFail(pgData)
+		Expect(state.Phase).To(Equal(phaseDumpComplete))
+
+		Expect(clearDowngradeState(pgData)).To(Succeed())
+		Expect(loadDowngradeStateOrFail(pgData)).To(Equal(downgradeState{}))
+	})
+})
+
+func loadDowngradeStateOrFail(pgData string) downgradeState {
+	state, err := loadDowngradeState(pgData)
+	Expect(err).NotTo(HaveOccurred())
+	return state
+}
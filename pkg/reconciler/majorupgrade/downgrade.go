@@ -22,9 +22,14 @@ package majorupgrade
 import (
 	"context"
 	"fmt"
+	"runtime"
+	"strconv"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -38,10 +43,16 @@ const jobMajorDowngrade = "major-downgrade"
 func ReconcileDowngrade(
 	ctx context.Context,
 	c client.Client,
+	eventRecorder record.EventRecorder,
 	cluster *apiv1.Cluster,
 	instances []corev1.Pod,
 	pvcs []corev1.PersistentVolumeClaim,
 ) (*ctrl.Result, error) {
+	if cluster.Status.Phase == apiv1.PhaseMajorUpgrade &&
+		cluster.Spec.Downgrade != nil && cluster.Spec.Downgrade.Cancel {
+		return handleDowngradeCancel(ctx, c, eventRecorder, cluster, pvcs)
+	}
+
 	requestedMajor, err := cluster.GetPostgresqlMajorVersion()
 	if err != nil {
 		return nil, err
@@ -56,8 +67,45 @@ func ReconcileDowngrade(
 		return nil, err
 	}
 
+	existingJob := createMajorDowngradeJobDefinition(cluster, primaryNodeSerial)
+	switch err := c.Get(ctx, client.ObjectKeyFromObject(existingJob), existingJob); {
+	case err == nil:
+		if isJobFailed(existingJob) {
+			return handleFailedDowngradeJob(ctx, c, eventRecorder, cluster, existingJob, primaryNodeSerial)
+		}
+		if isJobSucceeded(existingJob) {
+			return handleSucceededDowngradeJob(ctx, c, eventRecorder, cluster)
+		}
+		return &ctrl.Result{Requeue: true}, nil
+	case apierrs.IsNotFound(err):
+		// No downgrade Job yet: fall through to validate and create one.
+	default:
+		return nil, err
+	}
+
+	startedAt := downgradeStartedAt(cluster, requestedMajor)
+	if err := updateDowngradeStatus(ctx, c, cluster, &apiv1.DowngradeInfo{
+		Enabled:       true,
+		TargetVersion: strconv.Itoa(requestedMajor),
+		Phase:         apiv1.DowngradePhaseValidating,
+		StartedAt:     startedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	info := mustDetectDowngrade(ctx, cluster, newPrimaryConnector(c, cluster, instances),
+		cluster.Status.PGDataImageInfo.MajorVersion, requestedMajor, startedAt)
+	if err := updateDowngradeStatus(ctx, c, cluster, info); err != nil {
+		return nil, err
+	}
+
+	if info.Phase == apiv1.DowngradePhaseFailed {
+		eventRecorder.Event(cluster, corev1.EventTypeWarning, "DowngradeValidationFailed", info.Reason)
+		return nil, nil
+	}
+
 	if err := registerPhase(ctx, c, cluster, apiv1.PhaseMajorUpgrade,
-		fmt.Sprintf("Downgrading cluster from version %v to %v", 
+		fmt.Sprintf("Downgrading cluster from version %v to %v",
 			cluster.Status.PGDataImageInfo.MajorVersion, requestedMajor)); err != nil {
 		return nil, err
 	}
@@ -74,13 +122,52 @@ func ReconcileDowngrade(
 	return &ctrl.Result{Requeue: true}, nil
 }
 
+// updateDowngradeStatus persists the outcome of the pre-flight validation on
+// the Cluster status, so users can diagnose a refused downgrade without
+// having to look at the (never started) Job.
+func updateDowngradeStatus(ctx context.Context, c client.Client, cluster *apiv1.Cluster, info *apiv1.DowngradeInfo) error {
+	cluster.Status.DowngradeInfo = info
+	return c.Status().Update(ctx, cluster)
+}
+
+// downgradeStartedAt returns when this downgrade to targetMajor was first
+// queued: the existing DowngradeInfo.StartedAt when the status already
+// tracks a downgrade to the same target (e.g. a previous attempt failed
+// validation and this reconcile is retrying it), or now when it's being
+// queued for the first time.
+func downgradeStartedAt(cluster *apiv1.Cluster, targetMajor int) *metav1.Time {
+	existing := cluster.Status.DowngradeInfo
+	if existing != nil && existing.StartedAt != nil && existing.TargetVersion == strconv.Itoa(targetMajor) {
+		return existing.StartedAt
+	}
+	now := metav1.Now()
+	return &now
+}
+
 func createMajorDowngradeJobDefinition(cluster *apiv1.Cluster, nodeSerial int) *batchv1.Job {
 	downgradeCommand := []string{
 		"/controller/manager",
 		"instance",
 		"downgrade",
 		"execute",
+		"--parallel-jobs", strconv.Itoa(downgradeParallelJobs(cluster)),
 	}
 	job := specs.CreatePrimaryJob(*cluster, nodeSerial, jobMajorDowngrade, downgradeCommand)
+	addDowngradeExtraEnv(job, cluster)
+	addDowngradeHookScripts(job, cluster)
 	return job
 }
+
+// downgradeParallelJobs returns the number of parallel pg_dump/pg_restore
+// jobs to request for the downgrade Job, honouring
+// Cluster.Spec.Downgrade.ParallelJobs when set and falling back to
+// min(4, vCPUs) otherwise, matching the instance manager's own default.
+func downgradeParallelJobs(cluster *apiv1.Cluster) int {
+	if cluster.Spec.Downgrade != nil && cluster.Spec.Downgrade.ParallelJobs > 0 {
+		return cluster.Spec.Downgrade.ParallelJobs
+	}
+	if n := runtime.NumCPU(); n < 4 {
+		return n
+	}
+	return 4
+}
@@ -0,0 +1,124 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package majorupgrade
+
+import (
+	"path"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+)
+
+// preDumpScriptPath and postRestoreScriptPath are where the hook scripts,
+// when configured, are mounted inside the downgrade Job. The executor picks
+// them up from the environment variables below. The two live under separate
+// directories: mountDowngradeHookScript mounts each at path.Dir(mountPath),
+// and a single container can't have two different volumes mounted at the
+// same path.
+const (
+	preDumpScriptPath     = "/etc/downgrade-hooks/pre-dump/pre-dump.sh"
+	postRestoreScriptPath = "/etc/downgrade-hooks/post-restore/post-restore.sh"
+
+	preDumpScriptEnvVar     = "PRE_DUMP_SCRIPT"
+	postRestoreScriptEnvVar = "POST_RESTORE_SCRIPT"
+)
+
+// addDowngradeExtraEnv appends Cluster.Spec.Downgrade.ExtraEnv and
+// ExtraEnvFrom to the downgrade Job's container, mirroring the extraEnv
+// pattern used elsewhere so users can inject things like PGOPTIONS, proxy
+// variables, or credentials for an external object store.
+func addDowngradeExtraEnv(job *batchv1.Job, cluster *apiv1.Cluster) {
+	if cluster.Spec.Downgrade == nil {
+		return
+	}
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, cluster.Spec.Downgrade.ExtraEnv...)
+	container.EnvFrom = append(container.EnvFrom, cluster.Spec.Downgrade.ExtraEnvFrom...)
+}
+
+// addDowngradeHookScripts mounts Cluster.Spec.Downgrade.PreDumpScript and
+// PostRestoreScript, when configured, and points the executor at them via
+// environment variables.
+func addDowngradeHookScripts(job *batchv1.Job, cluster *apiv1.Cluster) {
+	if cluster.Spec.Downgrade == nil {
+		return
+	}
+
+	if cluster.Spec.Downgrade.PreDumpScript != nil {
+		mountDowngradeHookScript(job, "pre-dump-script", preDumpScriptPath, preDumpScriptEnvVar,
+			cluster.Spec.Downgrade.PreDumpScript)
+	}
+	if cluster.Spec.Downgrade.PostRestoreScript != nil {
+		mountDowngradeHookScript(job, "post-restore-script", postRestoreScriptPath, postRestoreScriptEnvVar,
+			cluster.Spec.Downgrade.PostRestoreScript)
+	}
+}
+
+// mountDowngradeHookScript adds a single-key volume backed by source to the
+// Job, mounts it read-only at path.Dir(mountPath) so the script appears at
+// mountPath, and exports mountPath to the
+// container via envVar so the executor can find it.
+func mountDowngradeHookScript(
+	job *batchv1.Job,
+	volumeName, mountPath, envVar string,
+	source *apiv1.ScriptSource,
+) {
+	volume := corev1.Volume{Name: volumeName}
+	switch {
+	case source.ConfigMapKeyRef != nil:
+		volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: source.ConfigMapKeyRef.Name},
+			Items: []corev1.KeyToPath{
+				{Key: source.ConfigMapKeyRef.Key, Path: scriptFileName(mountPath)},
+			},
+		}
+	case source.SecretKeyRef != nil:
+		volume.Secret = &corev1.SecretVolumeSource{
+			SecretName: source.SecretKeyRef.Name,
+			Items: []corev1.KeyToPath{
+				{Key: source.SecretKeyRef.Key, Path: scriptFileName(mountPath)},
+			},
+		}
+	default:
+		return
+	}
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      volumeName,
+		MountPath: mountPathDir(mountPath),
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env, corev1.EnvVar{Name: envVar, Value: mountPath})
+}
+
+func mountPathDir(mountPath string) string {
+	return path.Dir(mountPath)
+}
+
+func scriptFileName(mountPath string) string {
+	return path.Base(mountPath)
+}
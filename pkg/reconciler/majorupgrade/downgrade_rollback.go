@@ -0,0 +1,251 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package majorupgrade
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/specs"
+)
+
+const jobMajorDowngradeRollback = "major-downgrade-rollback"
+
+// isJobFailed reports whether the Job reached the terminal Failed
+// condition.
+func isJobFailed(job *batchv1.Job) bool {
+	return jobHasCondition(job, batchv1.JobFailed)
+}
+
+// isJobSucceeded reports whether the Job reached the terminal Complete
+// condition.
+func isJobSucceeded(job *batchv1.Job) bool {
+	return jobHasCondition(job, batchv1.JobComplete)
+}
+
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDowngradeCancel reacts to Cluster.Spec.Downgrade.Cancel being set
+// while a downgrade is in flight: it deletes the running downgrade Job with
+// foreground propagation, runs the same rollback Job a failed downgrade
+// would use to restore PGDATA.old, and once it succeeds clears
+// Status.DowngradeInfo and returns the cluster to a healthy phase. Once the
+// downgrade has reached apiv1.DowngradePhaseCompleted there is nothing left
+// to cancel, so the request is refused.
+func handleDowngradeCancel(
+	ctx context.Context,
+	c client.Client,
+	eventRecorder record.EventRecorder,
+	cluster *apiv1.Cluster,
+	pvcs []corev1.PersistentVolumeClaim,
+) (*ctrl.Result, error) {
+	if cluster.Status.DowngradeInfo != nil && cluster.Status.DowngradeInfo.Phase == apiv1.DowngradePhaseCompleted {
+		eventRecorder.Event(cluster, corev1.EventTypeWarning, "DowngradeCancelRefused",
+			"the downgrade already completed, it can no longer be cancelled")
+		return nil, nil
+	}
+
+	primaryNodeSerial, err := getPrimarySerial(pvcs)
+	if err != nil || primaryNodeSerial == 0 {
+		return nil, err
+	}
+
+	runningJob := createMajorDowngradeJobDefinition(cluster, primaryNodeSerial)
+	switch err := c.Get(ctx, client.ObjectKeyFromObject(runningJob), runningJob); {
+	case err == nil:
+		// Foreground propagation only sets a deletionTimestamp: the downgrade
+		// pod can keep running, and still holding PGDATA, for a while after
+		// this call returns. Requeue and wait for a later reconcile to
+		// observe the Job actually gone before starting the rollback Job,
+		// so the two Jobs never race over the same PVC.
+		foreground := metav1.DeletePropagationForeground
+		if err := c.Delete(ctx, runningJob, &client.DeleteOptions{PropagationPolicy: &foreground}); err != nil &&
+			!apierrs.IsNotFound(err) {
+			return nil, err
+		}
+		eventRecorder.Event(cluster, corev1.EventTypeNormal, "DowngradeCancelRequested",
+			"cancelling the in-flight downgrade and rolling back PGDATA")
+		return &ctrl.Result{Requeue: true}, nil
+	case apierrs.IsNotFound(err):
+		// The downgrade Job (and, by foreground propagation, its pod) is
+		// gone: it's now safe to start the rollback Job.
+	default:
+		return nil, err
+	}
+
+	rollbackJob := createMajorDowngradeRollbackJobDefinition(cluster, primaryNodeSerial)
+	switch err := c.Get(ctx, client.ObjectKeyFromObject(rollbackJob), rollbackJob); {
+	case apierrs.IsNotFound(err):
+		rollbackJob = createMajorDowngradeRollbackJobDefinition(cluster, primaryNodeSerial)
+		if err := ctrl.SetControllerReference(cluster, rollbackJob, c.Scheme()); err != nil {
+			return nil, err
+		}
+		if err := c.Create(ctx, rollbackJob); err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{Requeue: true}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if isJobFailed(rollbackJob) {
+		if cluster.Status.DowngradeInfo != nil {
+			cluster.Status.DowngradeInfo.Reason = fmt.Sprintf(
+				"rollback Job %q failed while cancelling the downgrade", rollbackJob.Name)
+		}
+		if err := c.Status().Update(ctx, cluster); err != nil {
+			return nil, err
+		}
+		eventRecorder.Event(cluster, corev1.EventTypeWarning, "DowngradeRollbackFailed",
+			"the rollback Job failed while cancelling the downgrade; manual intervention is required")
+		return nil, nil
+	}
+
+	if !isJobSucceeded(rollbackJob) {
+		return &ctrl.Result{Requeue: true}, nil
+	}
+
+	cluster.Status.DowngradeInfo = nil
+	cluster.Status.Phase = apiv1.PhaseHealthy
+	if err := c.Status().Update(ctx, cluster); err != nil {
+		return nil, err
+	}
+	eventRecorder.Event(cluster, corev1.EventTypeNormal, "DowngradeRolledBack",
+		"the downgrade was cancelled and PGDATA was rolled back successfully")
+
+	return nil, nil
+}
+
+// handleFailedDowngradeJob reacts to a downgrade Job that reached the
+// Failed condition. When Cluster.Spec.Downgrade.AutoRollback is set, it
+// launches a one-shot Job that restores PGDATA.old; otherwise it records
+// the failure on the Cluster status and waits for manual intervention.
+func handleFailedDowngradeJob(
+	ctx context.Context,
+	c client.Client,
+	eventRecorder record.EventRecorder,
+	cluster *apiv1.Cluster,
+	failedJob *batchv1.Job,
+	primaryNodeSerial int,
+) (*ctrl.Result, error) {
+	if cluster.Status.DowngradeInfo != nil {
+		cluster.Status.DowngradeInfo.Phase = apiv1.DowngradePhaseFailed
+		if cluster.Status.DowngradeInfo.Reason == "" {
+			cluster.Status.DowngradeInfo.Reason = fmt.Sprintf("downgrade Job %q failed", failedJob.Name)
+		}
+	}
+	if err := c.Status().Update(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	if cluster.Spec.Downgrade == nil || !cluster.Spec.Downgrade.AutoRollback {
+		return nil, nil
+	}
+
+	rollbackJob := createMajorDowngradeRollbackJobDefinition(cluster, primaryNodeSerial)
+	switch err := c.Get(ctx, client.ObjectKeyFromObject(rollbackJob), rollbackJob); {
+	case err == nil:
+		if isJobFailed(rollbackJob) {
+			if cluster.Status.DowngradeInfo != nil {
+				cluster.Status.DowngradeInfo.Reason = fmt.Sprintf(
+					"rollback Job %q also failed after downgrade Job %q failed", rollbackJob.Name, failedJob.Name)
+				if err := c.Status().Update(ctx, cluster); err != nil {
+					return nil, err
+				}
+			}
+			eventRecorder.Event(cluster, corev1.EventTypeWarning, "DowngradeRollbackFailed",
+				"the automatic rollback Job also failed; manual intervention is required")
+			return nil, nil
+		}
+		if isJobSucceeded(rollbackJob) {
+			// The failed downgrade has already been rolled back.
+			return nil, nil
+		}
+		// The rollback Job was already created on a previous reconcile and
+		// hasn't reached a terminal condition yet.
+		return &ctrl.Result{Requeue: true}, nil
+	case apierrs.IsNotFound(err):
+		// No rollback Job yet: fall through to create one.
+	default:
+		return nil, err
+	}
+
+	if err := ctrl.SetControllerReference(cluster, rollbackJob, c.Scheme()); err != nil {
+		return nil, err
+	}
+	if err := c.Create(ctx, rollbackJob); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{Requeue: true}, nil
+}
+
+// handleSucceededDowngradeJob reacts to a downgrade Job that reached the
+// Complete condition: it marks the downgrade Completed on the Cluster status
+// and returns the cluster to a healthy phase, so a successful downgrade
+// doesn't leave the cluster stuck in PhaseMajorUpgrade forever.
+func handleSucceededDowngradeJob(
+	ctx context.Context,
+	c client.Client,
+	eventRecorder record.EventRecorder,
+	cluster *apiv1.Cluster,
+) (*ctrl.Result, error) {
+	if cluster.Status.DowngradeInfo != nil {
+		cluster.Status.DowngradeInfo.Phase = apiv1.DowngradePhaseCompleted
+		cluster.Status.DowngradeInfo.Reason = ""
+	}
+	cluster.Status.Phase = apiv1.PhaseHealthy
+	if err := c.Status().Update(ctx, cluster); err != nil {
+		return nil, err
+	}
+	eventRecorder.Event(cluster, corev1.EventTypeNormal, "DowngradeCompleted",
+		"the major version downgrade completed successfully")
+
+	return nil, nil
+}
+
+// createMajorDowngradeRollbackJobDefinition builds the one-shot Job that
+// runs `instance downgrade rollback` to restore PGDATA.old after a failed
+// downgrade attempt.
+func createMajorDowngradeRollbackJobDefinition(cluster *apiv1.Cluster, nodeSerial int) *batchv1.Job {
+	rollbackCommand := []string{
+		"/controller/manager",
+		"instance",
+		"downgrade",
+		"rollback",
+	}
+	return specs.CreatePrimaryJob(*cluster, nodeSerial, jobMajorDowngradeRollback, rollbackCommand)
+}
@@ -0,0 +1,337 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package majorupgrade
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+)
+
+// primaryConnector opens a connection to the running primary, so the
+// downgrade validator can inspect its catalogs. It is an interface purely
+// so tests can stub it without dialing a real server.
+type primaryConnector interface {
+	Connect(ctx context.Context) (*pgx.Conn, error)
+}
+
+// mustDetectDowngrade inspects the running primary and the Cluster spec to
+// decide whether the requested downgrade can be attempted at all. It never
+// touches data: a positive result only means the pre-flight checks did not
+// find a known reason to refuse the downgrade, not that the dump/restore
+// itself will succeed.
+//
+// The checks mirror etcd's downgrade validation: only a single major
+// version step is allowed at a time, the target must be one of the
+// versions the cluster is configured to support, and the primary must not
+// be using catalog objects that don't exist in the target major.
+//
+// startedAt is stamped onto the returned info unchanged: the caller is
+// responsible for picking it (the first time this downgrade was queued)
+// and carrying it across retries, so a downgrade that gets re-validated
+// over several reconciles doesn't appear to restart its clock each time.
+func mustDetectDowngrade(
+	ctx context.Context,
+	cluster *apiv1.Cluster,
+	conn primaryConnector,
+	currentMajor, targetMajor int,
+	startedAt *metav1.Time,
+) *apiv1.DowngradeInfo {
+	info := &apiv1.DowngradeInfo{
+		Enabled:       true,
+		TargetVersion: fmt.Sprintf("%d", targetMajor),
+		Phase:         apiv1.DowngradePhaseValidating,
+		StartedAt:     startedAt,
+	}
+
+	if currentMajor-targetMajor > 1 {
+		info.Phase = apiv1.DowngradePhaseFailed
+		info.Reason = fmt.Sprintf(
+			"cannot downgrade more than one major version at a time (from %d to %d)",
+			currentMajor, targetMajor)
+		return info
+	}
+
+	if !isSupportedVersion(cluster, targetMajor) {
+		info.Phase = apiv1.DowngradePhaseFailed
+		info.Reason = fmt.Sprintf("PostgreSQL %d is not one of the cluster's configured PostgresVersions", targetMajor)
+		return info
+	}
+
+	if reason := checkCatalogIncompatibilities(ctx, conn, cluster, targetMajor); reason != "" {
+		info.Phase = apiv1.DowngradePhaseFailed
+		info.Reason = reason
+		return info
+	}
+
+	info.Phase = apiv1.DowngradePhasePlanned
+	return info
+}
+
+// isSupportedVersion reports whether targetMajor is one of the major
+// versions the cluster is configured to accept.
+func isSupportedVersion(cluster *apiv1.Cluster, targetMajor int) bool {
+	for _, version := range cluster.Spec.PostgresVersions {
+		if version == targetMajor {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCatalogIncompatibilities connects to the primary and looks for
+// objects that are known not to survive a downgrade to targetMajor. It
+// returns a human-readable reason when an incompatibility is found, or the
+// empty string when none are found.
+//
+// Scope note: the request that introduced this validator also asked for
+// rejecting pg_catalog.pg_proc functions that use SQL features unavailable
+// in the target major. That isn't implemented: pg_proc doesn't record
+// which features a function body uses, so answering it would mean parsing
+// every function's source against the target major's grammar, which this
+// validator has no way to do. Everything else it asked for — extensions,
+// removed GUCs, collation/locale providers (of databases only), and data
+// types introduced after the target major — is checked below.
+//
+// The connection is to the postgres database. pg_extension and pg_attribute
+// are per-database catalogs, so the extension and data type checks see only
+// the objects of that database; other databases are not inspected.
+func checkCatalogIncompatibilities(
+	ctx context.Context, connector primaryConnector, cluster *apiv1.Cluster, targetMajor int,
+) string {
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return fmt.Sprintf("could not connect to the primary to validate the downgrade: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	if reason := checkExtensions(ctx, conn, cluster, targetMajor); reason != "" {
+		return reason
+	}
+	if reason := checkRemovedGUCs(ctx, conn, targetMajor); reason != "" {
+		return reason
+	}
+	if reason := checkCollationProviders(ctx, conn, targetMajor); reason != "" {
+		return reason
+	}
+	if reason := checkDataTypes(ctx, conn, targetMajor); reason != "" {
+		return reason
+	}
+
+	return ""
+}
+
+// checkExtensions rejects the downgrade when an extension installed in the
+// connected (postgres) database isn't in Spec.Downgrade.AvailableExtensions, the set of extensions known to be
+// packaged in the target image. The primary's own catalog can't answer
+// this: it is still running the current (newer) image, so every extension
+// installed on it is by definition available there, regardless of what
+// the target image provides. The check is skipped, rather than refusing
+// every downgrade outright, when AvailableExtensions is unset.
+func checkExtensions(ctx context.Context, conn *pgx.Conn, cluster *apiv1.Cluster, targetMajor int) string {
+	if cluster.Spec.Downgrade == nil || len(cluster.Spec.Downgrade.AvailableExtensions) == 0 {
+		return ""
+	}
+	available := make(map[string]bool, len(cluster.Spec.Downgrade.AvailableExtensions))
+	for _, name := range cluster.Spec.Downgrade.AvailableExtensions {
+		available[name] = true
+	}
+
+	rows, err := conn.Query(ctx, `SELECT extname FROM pg_extension`)
+	if err != nil {
+		return fmt.Sprintf("could not list installed extensions: %v", err)
+	}
+	defer rows.Close()
+
+	var incompatible []string
+	for rows.Next() {
+		var extname string
+		if err := rows.Scan(&extname); err != nil {
+			return fmt.Sprintf("could not read installed extensions: %v", err)
+		}
+		if !available[extname] {
+			incompatible = append(incompatible, extname)
+		}
+	}
+
+	if len(incompatible) > 0 {
+		return fmt.Sprintf("extensions with no package for PostgreSQL %d: %v", targetMajor, incompatible)
+	}
+	return ""
+}
+
+// checkRemovedGUCs rejects the downgrade when a GUC set on the primary does
+// not exist in the target major (i.e. it was introduced after it).
+func checkRemovedGUCs(ctx context.Context, conn *pgx.Conn, targetMajor int) string {
+	row := conn.QueryRow(ctx, `
+		SELECT count(*)
+		FROM pg_settings
+		WHERE source NOT IN ('default', 'override')
+		  AND name = ANY($1)`, removedGUCsForMajor(targetMajor))
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return fmt.Sprintf("could not inspect pg_settings: %v", err)
+	}
+	if count > 0 {
+		return fmt.Sprintf("cluster relies on GUCs that don't exist in PostgreSQL %d", targetMajor)
+	}
+	return ""
+}
+
+// checkCollationProviders rejects the downgrade when a database uses the
+// builtin locale provider, which is unsupported before PostgreSQL 17. Columns
+// and collations using that provider are not checked.
+func checkCollationProviders(ctx context.Context, conn *pgx.Conn, targetMajor int) string {
+	if targetMajor >= 17 {
+		return ""
+	}
+
+	row := conn.QueryRow(ctx, `
+		SELECT count(*)
+		FROM pg_database
+		WHERE datlocprovider = 'b'`)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return fmt.Sprintf("could not inspect pg_database locale providers: %v", err)
+	}
+	if count > 0 {
+		return fmt.Sprintf("builtin collation provider is not available in PostgreSQL %d", targetMajor)
+	}
+	return ""
+}
+
+// removedGUCsForMajor returns the GUCs known to be unavailable in the given
+// target major version.
+func removedGUCsForMajor(targetMajor int) []string {
+	switch {
+	case targetMajor < 17:
+		return []string{"transaction_timeout"}
+	default:
+		return []string{}
+	}
+}
+
+// checkDataTypes rejects the downgrade when a column of the connected
+// (postgres) database uses a built-in data type introduced after the target
+// major version, which pg_restore onto
+// that target wouldn't recognize.
+func checkDataTypes(ctx context.Context, conn *pgx.Conn, targetMajor int) string {
+	typeNames := postTargetDataTypesForMajor(targetMajor)
+	if len(typeNames) == 0 {
+		return ""
+	}
+
+	row := conn.QueryRow(ctx, `
+		SELECT count(*)
+		FROM pg_attribute a
+		JOIN pg_type t ON t.oid = a.atttypid
+		WHERE a.attnum > 0 AND NOT a.attisdropped
+		  AND t.typname = ANY($1)`, typeNames)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return fmt.Sprintf("could not inspect column data types: %v", err)
+	}
+	if count > 0 {
+		return fmt.Sprintf("cluster has columns using data types not available in PostgreSQL %d", targetMajor)
+	}
+	return ""
+}
+
+// postTargetDataTypesForMajor returns the built-in pg_type names
+// introduced after the given target major version.
+func postTargetDataTypesForMajor(targetMajor int) []string {
+	var types []string
+	if targetMajor < 12 {
+		types = append(types, "jsonpath")
+	}
+	if targetMajor < 13 {
+		types = append(types, "xid8")
+	}
+	if targetMajor < 14 {
+		types = append(types,
+			"int4multirange", "int8multirange", "nummultirange",
+			"datemultirange", "tsmultirange", "tstzmultirange", "anymultirange")
+	}
+	return types
+}
+
+// podPrimaryConnector connects to the primary over the Pod network, reusing
+// the superuser credentials the operator already holds for the cluster
+// rather than dialing in as an unauthenticated user.
+type podPrimaryConnector struct {
+	client  client.Client
+	cluster *apiv1.Cluster
+	pod     *corev1.Pod
+}
+
+// newPrimaryConnector returns a primaryConnector for the current primary
+// among instances, or a connector that always fails when no primary Pod is
+// running (e.g. during a failover).
+func newPrimaryConnector(c client.Client, cluster *apiv1.Cluster, instances []corev1.Pod) primaryConnector {
+	for i := range instances {
+		if instances[i].Name == cluster.Status.CurrentPrimary {
+			return &podPrimaryConnector{client: c, cluster: cluster, pod: &instances[i]}
+		}
+	}
+	return &podPrimaryConnector{client: c, cluster: cluster}
+}
+
+// Connect dials the primary using the same superuser credentials the
+// instance manager itself authenticates with, fetched from the cluster's
+// superuser Secret, with TLS required rather than the plaintext,
+// unauthenticated connection this used to hand-roll. The username and
+// password are set on the parsed config directly rather than interpolated
+// into the DSN string, so a secret value containing a space, quote, or
+// backslash can't be mis-parsed as (or inject) other keywords.
+func (p *podPrimaryConnector) Connect(ctx context.Context) (*pgx.Conn, error) {
+	if p.pod == nil {
+		return nil, fmt.Errorf("no running primary pod found for cluster %s", p.cluster.Name)
+	}
+
+	var secret corev1.Secret
+	secretKey := client.ObjectKey{Namespace: p.cluster.Namespace, Name: p.cluster.GetSuperuserSecretName()}
+	if err := p.client.Get(ctx, secretKey, &secret); err != nil {
+		return nil, fmt.Errorf("could not read superuser credentials for cluster %s: %w", p.cluster.Name, err)
+	}
+
+	username := string(secret.Data[corev1.BasicAuthUsernameKey])
+	if username == "" {
+		username = "postgres"
+	}
+
+	connConfig, err := pgx.ParseConfig(fmt.Sprintf(
+		"host=%s dbname=postgres sslmode=require connect_timeout=5", p.pod.Status.PodIP))
+	if err != nil {
+		return nil, fmt.Errorf("while building the primary connection config for cluster %s: %w", p.cluster.Name, err)
+	}
+	connConfig.User = username
+	connConfig.Password = string(secret.Data[corev1.BasicAuthPasswordKey])
+
+	return pgx.ConnectConfig(ctx, connConfig)
+}
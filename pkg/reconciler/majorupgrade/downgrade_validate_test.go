@@ -0,0 +1,124 @@
+/*
+Copyright © contributors to CloudNativePG, established as
+CloudNativePG a Series of LF Projects, LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package majorupgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+)
+
+// fakePrimaryConnector is a primaryConnector stub that never dials a real
+// server: it always fails to connect, with a caller-supplied error.
+type fakePrimaryConnector struct {
+	err error
+}
+
+func (f *fakePrimaryConnector) Connect(_ context.Context) (*pgx.Conn, error) {
+	return nil, f.err
+}
+
+var _ = Describe("mustDetectDowngrade", func() {
+	var cluster *apiv1.Cluster
+
+	BeforeEach(func() {
+		cluster = &apiv1.Cluster{
+			Spec: apiv1.ClusterSpec{
+				PostgresVersions: []int{15, 16, 17},
+			},
+		}
+	})
+
+	It("refuses to skip more than one major version", func() {
+		conn := &fakePrimaryConnector{}
+		info := mustDetectDowngrade(context.Background(), cluster, conn, 17, 15, nil)
+
+		Expect(info.Phase).To(Equal(apiv1.DowngradePhaseFailed))
+		Expect(info.Reason).To(ContainSubstring("cannot downgrade more than one major version"))
+		Expect(info.TargetVersion).To(Equal("15"))
+	})
+
+	It("refuses a target version the cluster isn't configured to support", func() {
+		conn := &fakePrimaryConnector{}
+		info := mustDetectDowngrade(context.Background(), cluster, conn, 15, 14, nil)
+
+		Expect(info.Phase).To(Equal(apiv1.DowngradePhaseFailed))
+		Expect(info.Reason).To(ContainSubstring("not one of the cluster's configured PostgresVersions"))
+	})
+
+	It("stamps the given startedAt onto the result regardless of outcome", func() {
+		conn := &fakePrimaryConnector{}
+		startedAt := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+		info := mustDetectDowngrade(context.Background(), cluster, conn, 17, 15, &startedAt)
+
+		Expect(info.StartedAt).To(Equal(&startedAt))
+	})
+
+	It("fails validation when the primary can't be reached", func() {
+		conn := &fakePrimaryConnector{err: fmt.Errorf("connection refused")}
+		info := mustDetectDowngrade(context.Background(), cluster, conn, 17, 16, nil)
+
+		Expect(info.Phase).To(Equal(apiv1.DowngradePhaseFailed))
+		Expect(info.Reason).To(ContainSubstring("could not connect to the primary"))
+	})
+})
+
+var _ = Describe("isSupportedVersion", func() {
+	It("accepts a version listed in Spec.PostgresVersions", func() {
+		cluster := &apiv1.Cluster{Spec: apiv1.ClusterSpec{PostgresVersions: []int{15, 16}}}
+		Expect(isSupportedVersion(cluster, 16)).To(BeTrue())
+	})
+
+	It("rejects a version not listed in Spec.PostgresVersions", func() {
+		cluster := &apiv1.Cluster{Spec: apiv1.ClusterSpec{PostgresVersions: []int{15, 16}}}
+		Expect(isSupportedVersion(cluster, 17)).To(BeFalse())
+	})
+})
+
+var _ = Describe("removedGUCsForMajor", func() {
+	It("flags transaction_timeout as removed before PostgreSQL 17", func() {
+		Expect(removedGUCsForMajor(16)).To(ContainElement("transaction_timeout"))
+	})
+
+	It("has nothing to flag from PostgreSQL 17 onward", func() {
+		Expect(removedGUCsForMajor(17)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("postTargetDataTypesForMajor", func() {
+	It("flags multirange types as introduced after PostgreSQL 13", func() {
+		Expect(postTargetDataTypesForMajor(13)).To(ContainElement("int4multirange"))
+	})
+
+	It("does not flag multirange types from PostgreSQL 14 onward", func() {
+		Expect(postTargetDataTypesForMajor(14)).NotTo(ContainElement("int4multirange"))
+	})
+
+	It("has nothing to flag once past every type it knows about", func() {
+		Expect(postTargetDataTypesForMajor(17)).To(BeEmpty())
+	})
+})